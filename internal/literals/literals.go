@@ -5,8 +5,9 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
-	mathrand "math/rand"
+	"math"
 	"strconv"
+	"strings"
 
 	"golang.org/x/tools/go/ast/astutil"
 )
@@ -25,20 +26,59 @@ func callExpr(resultType ast.Expr, block *ast.BlockStmt) *ast.CallExpr {
 	}}
 }
 
-func randObfuscator() obfuscator {
-	randPos := mathrand.Intn(len(obfuscators))
-	return obfuscators[randPos]
-}
-
 func returnStmt(result ast.Expr) *ast.ReturnStmt {
 	return &ast.ReturnStmt{
 		Results: []ast.Expr{result},
 	}
 }
 
-// Obfuscate replace literals with obfuscated lambda functions
-func Obfuscate(files []*ast.File, info *types.Info, fset *token.FileSet, blacklist map[types.Object]struct{}) []*ast.File {
-	pre := func(cursor *astutil.Cursor) bool {
+// obfuscateBlock picks an Obfuscator for data and returns the block that
+// reconstructs it into "data", along with any package-level declarations the
+// obfuscator needed to splice in alongside it (see DeclObfuscator).
+func obfuscateBlock(data []byte, policy *Policy) (*ast.BlockStmt, []ast.Decl) {
+	o := policy.pick(data)
+	if d, ok := o.(DeclObfuscator); ok {
+		return d.Decls(data, policy.source)
+	}
+	return o.Obfuscate(data, policy.source), nil
+}
+
+// Obfuscate replace literals with obfuscated lambda functions. A nil policy
+// uses the package defaults (SelectRandom, no size filtering).
+func Obfuscate(files []*ast.File, info *types.Info, fset *token.FileSet, blacklist map[types.Object]struct{}, policy *Policy) []*ast.File {
+	if policy == nil {
+		policy = &Policy{}
+	}
+
+	// usedMath records whether obfuscateFloat emitted a math.Float32/64frombits
+	// call for the file currently being rewritten, so we know to add the import.
+	usedMath := false
+
+	// extraDecls collects the package-level declarations obfuscators ask to
+	// have spliced into the file currently being rewritten (see
+	// DeclObfuscator), so they can be appended once astutil.Apply finishes
+	// walking it.
+	var extraDecls []ast.Decl
+
+	// ancestors mirrors the path from the file root down to the node
+	// currently being visited, so post can look past a literal's immediate,
+	// possibly still-untyped, AST parent to find the type it actually
+	// resolves to (see resolveNumericType) and tell whether it sits inside
+	// an array length (see arrayLenDepth).
+	var ancestors []ast.Node
+
+	// arrayLenDepth counts how many ArrayType.Len expressions currently
+	// enclose the node being visited. Array lengths must stay constant, and
+	// a bare literal there has no types.Object for ConstBlacklist to catch,
+	// so BasicLit skips obfuscating numbers while this is non-zero.
+	arrayLenDepth := 0
+
+	enterLen := func(cursor *astutil.Cursor) bool {
+		_, ok := cursor.Parent().(*ast.ArrayType)
+		return ok && cursor.Name() == "Len"
+	}
+
+	rawPre := func(cursor *astutil.Cursor) bool {
 		switch x := cursor.Node().(type) {
 
 		case *ast.GenDecl:
@@ -79,58 +119,96 @@ func Obfuscate(files []*ast.File, info *types.Info, fset *token.FileSet, blackli
 		return true
 	}
 
-	post := func(cursor *astutil.Cursor) bool {
+	pre := func(cursor *astutil.Cursor) bool {
+		ancestors = append(ancestors, cursor.Node())
+		if enterLen(cursor) {
+			arrayLenDepth++
+		}
+
+		if rawPre(cursor) {
+			return true
+		}
+		ancestors = ancestors[:len(ancestors)-1]
+		if enterLen(cursor) {
+			arrayLenDepth--
+		}
+		return false
+	}
+
+	rawPost := func(cursor *astutil.Cursor) bool {
 		switch x := cursor.Node().(type) {
 		case *ast.CompositeLit:
 			byteType := types.Universe.Lookup("byte").Type()
 
+			// byte-array and byte-slice conversions below use break rather
+			// than return on a mismatch, so a composite literal that turns
+			// out not to be one - e.g. a []string or [N]string - still
+			// reaches the obfuscateCompositeStrings call after the switch.
 			switch y := info.TypeOf(x.Type).(type) {
 			case *types.Array:
 				if y.Elem() != byteType {
-					return true
+					break
 				}
 
 				data := make([]byte, y.Len())
 
+				ok := true
 				for i, el := range x.Elts {
-					lit, ok := el.(*ast.BasicLit)
-					if !ok {
-						return true
+					lit, litOk := el.(*ast.BasicLit)
+					if !litOk {
+						ok = false
+						break
 					}
 
 					value, err := strconv.Atoi(lit.Value)
 					if err != nil {
-						return true
+						ok = false
+						break
 					}
 
 					data[i] = byte(value)
 				}
-				cursor.Replace(obfuscateByteArray(data, y.Len()))
+				if !ok {
+					break
+				}
+				call, decls := obfuscateByteArray(data, y.Len(), policy)
+				extraDecls = append(extraDecls, decls...)
+				cursor.Replace(call)
 
 			case *types.Slice:
 				if y.Elem() != byteType {
-					return true
+					break
 				}
 
 				var data []byte
 
+				ok := true
 				for _, el := range x.Elts {
-					lit, ok := el.(*ast.BasicLit)
-					if !ok {
-						return true
+					lit, litOk := el.(*ast.BasicLit)
+					if !litOk {
+						ok = false
+						break
 					}
 
 					value, err := strconv.Atoi(lit.Value)
 					if err != nil {
-						return true
+						ok = false
+						break
 					}
 
 					data = append(data, byte(value))
 				}
-				cursor.Replace(obfuscateByteSlice(data))
+				if !ok {
+					break
+				}
+				call, decls := obfuscateByteSlice(data, policy)
+				extraDecls = append(extraDecls, decls...)
+				cursor.Replace(call)
 
 			}
 
+			extraDecls = append(extraDecls, obfuscateCompositeStrings(x, info, policy)...)
+
 		case *ast.BasicLit:
 			switch cursor.Name() {
 			case "Values", "Rhs", "Value", "Args", "X", "Y", "Results":
@@ -149,22 +227,69 @@ func Obfuscate(files []*ast.File, info *types.Info, fset *token.FileSet, blackli
 					panic(fmt.Sprintf("cannot unquote string: %v", err))
 				}
 
-				cursor.Replace(obfuscateString(value))
+				call, decls := obfuscateString(value, policy)
+				extraDecls = append(extraDecls, decls...)
+				cursor.Replace(call)
+
+			case token.INT, token.FLOAT, token.IMAG:
+				if arrayLenDepth > 0 {
+					// an array length must stay a compile-time constant; a
+					// bare literal here has no types.Object for
+					// ConstBlacklist to catch, so skip it structurally.
+					return true
+				}
+
+				// ancestors[:len(ancestors)-1] excludes x itself, which
+				// pre already pushed.
+				basic := resolveNumericType(x, ancestors[:len(ancestors)-1], info)
+				if basic == nil {
+					return true
+				}
+
+				replacement, decls, ok := obfuscateNumber(x, basic, policy)
+				if !ok {
+					return true
+				}
+				switch basic.Kind() {
+				case types.Float32, types.Float64, types.UntypedFloat,
+					types.Complex64, types.Complex128, types.UntypedComplex:
+					usedMath = true
+				}
+				extraDecls = append(extraDecls, decls...)
+				cursor.Replace(replacement)
 			}
 		}
 
 		return true
 	}
 
+	post := func(cursor *astutil.Cursor) bool {
+		keep := rawPost(cursor)
+		if enterLen(cursor) {
+			arrayLenDepth--
+		}
+		ancestors = ancestors[:len(ancestors)-1]
+		return keep
+	}
+
 	for i := range files {
+		usedMath = false
+		extraDecls = nil
+		ancestors = nil
+		arrayLenDepth = 0
 		files[i] = astutil.Apply(files[i], pre, post).(*ast.File)
+		if usedMath {
+			astutil.AddImport(fset, files[i], "math")
+		}
+		if len(extraDecls) > 0 {
+			files[i].Decls = append(files[i].Decls, extraDecls...)
+		}
 	}
 	return files
 }
 
-func obfuscateString(data string) *ast.CallExpr {
-	obfuscator := randObfuscator()
-	block := obfuscator.obfuscate([]byte(data))
+func obfuscateString(data string, policy *Policy) (*ast.CallExpr, []ast.Decl) {
+	block, decls := obfuscateBlock([]byte(data), policy)
 	block.List = append(block.List, &ast.ReturnStmt{
 		Results: []ast.Expr{&ast.CallExpr{
 			Fun:  &ast.Ident{Name: "string"},
@@ -172,21 +297,19 @@ func obfuscateString(data string) *ast.CallExpr {
 		}},
 	})
 
-	return callExpr(&ast.Ident{Name: "string"}, block)
+	return callExpr(&ast.Ident{Name: "string"}, block), decls
 }
 
-func obfuscateByteSlice(data []byte) *ast.CallExpr {
-	obfuscator := randObfuscator()
-	block := obfuscator.obfuscate(data)
+func obfuscateByteSlice(data []byte, policy *Policy) (*ast.CallExpr, []ast.Decl) {
+	block, decls := obfuscateBlock(data, policy)
 	block.List = append(block.List, &ast.ReturnStmt{
 		Results: []ast.Expr{&ast.Ident{Name: "data"}},
 	})
-	return callExpr(&ast.ArrayType{Elt: &ast.Ident{Name: "byte"}}, block)
+	return callExpr(&ast.ArrayType{Elt: &ast.Ident{Name: "byte"}}, block), decls
 }
 
-func obfuscateByteArray(data []byte, length int64) *ast.CallExpr {
-	obfuscator := randObfuscator()
-	block := obfuscator.obfuscate(data)
+func obfuscateByteArray(data []byte, length int64, policy *Policy) (*ast.CallExpr, []ast.Decl) {
+	block, decls := obfuscateBlock(data, policy)
 
 	arrayType := &ast.ArrayType{
 		Len: &ast.BasicLit{
@@ -231,7 +354,301 @@ func obfuscateByteArray(data []byte, length int64) *ast.CallExpr {
 
 	block.List = append(block.List, sliceToArray...)
 
-	return callExpr(arrayType, block)
+	return callExpr(arrayType, block), decls
+}
+
+// obfuscateCompositeStrings replaces the positional (non key:value) string
+// elements of a slice-of-string, array-of-string, or struct composite literal
+// with obfuscated calls, in place, and returns any package-level declarations
+// those obfuscators asked to splice in. Map values and keyed struct fields are
+// *ast.KeyValueExpr values and are already obfuscated by the *ast.BasicLit
+// case above, since they're reached under the "Value" field name rather than
+// "Elts"; handling them again here would double-wrap them. Map and struct
+// keys are left alone, as they must stay comparable/constant. info.TypeOf(x)
+// (rather than x.Type) is used so elided nested composite literals, e.g. the
+// inner {"a", "b"} in [][]string{{"a", "b"}}, are still recognized.
+func obfuscateCompositeStrings(x *ast.CompositeLit, info *types.Info, policy *Policy) []ast.Decl {
+	strType := types.Typ[types.String]
+
+	structType, isStruct := info.TypeOf(x).Underlying().(*types.Struct)
+	if !isStruct {
+		var elemType types.Type
+		switch underlying := info.TypeOf(x).Underlying().(type) {
+		case *types.Slice:
+			elemType = underlying.Elem()
+		case *types.Array:
+			elemType = underlying.Elem()
+		}
+		if elemType != strType {
+			return nil
+		}
+	}
+
+	var decls []ast.Decl
+
+	for i, elt := range x.Elts {
+		if isStruct {
+			if i >= structType.NumFields() || structType.Field(i).Type() != strType {
+				continue
+			}
+		}
+
+		lit, ok := elt.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			continue
+		}
+
+		value, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			continue
+		}
+
+		call, eltDecls := obfuscateString(value, policy)
+		decls = append(decls, eltDecls...)
+		x.Elts[i] = call
+	}
+
+	return decls
+}
+
+// basicResultName returns the type name to convert an obfuscated numeric
+// literal back to. Untyped constants are given their Go default type, since
+// an untyped value has no explicit type to reuse in a conversion.
+func basicResultName(basic *types.Basic) string {
+	switch basic.Kind() {
+	case types.UntypedInt:
+		return "int"
+	case types.UntypedRune:
+		return "rune"
+	case types.UntypedFloat:
+		return "float64"
+	case types.UntypedComplex:
+		return "complex128"
+	default:
+		return basic.Name()
+	}
+}
+
+// intLit builds an *ast.BasicLit for the integer v.
+func intLit(v int) *ast.BasicLit {
+	return &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(v)}
+}
+
+// recomposeUint builds the expression that reassembles an n-byte little
+// endian value out of the "data" []byte produced by an obfuscator.
+func recomposeUint(n int) ast.Expr {
+	var expr ast.Expr
+	for i := 0; i < n; i++ {
+		byteExpr := &ast.CallExpr{
+			Fun: &ast.Ident{Name: "uint64"},
+			Args: []ast.Expr{&ast.IndexExpr{
+				X:     &ast.Ident{Name: "data"},
+				Index: intLit(i),
+			}},
+		}
+
+		var term ast.Expr = byteExpr
+		if i > 0 {
+			term = &ast.BinaryExpr{X: byteExpr, Op: token.SHL, Y: intLit(8 * i)}
+		}
+
+		if expr == nil {
+			expr = term
+		} else {
+			expr = &ast.BinaryExpr{X: expr, Op: token.OR, Y: term}
+		}
+	}
+	return expr
+}
+
+// resolveNumericType returns the Basic type a numeric literal should be
+// reconstructed as. A literal that is itself an operand of a larger
+// constant expression - e.g. the 42 in `var x int8 = -42`, or either 1 or 2
+// in `var y int8 = 1 + 2` - is recorded by go/types as untyped, even though
+// the enclosing expression resolves to a concrete type; reconstructing from
+// the literal's own (untyped) type would emit the wrong width and fail to
+// compile. So when the literal's own type is untyped, this walks up through
+// its unary/binary/paren ancestors, nearest first, until it finds one whose
+// resolved type is no longer untyped, and uses that instead. It gives up and
+// returns the type resolved so far - the literal's own type, or the last
+// untyped ancestor's - if the chain is broken by anything else (a composite
+// literal, a call argument, ...), since that type is already correct for
+// those positions.
+func resolveNumericType(lit *ast.BasicLit, ancestors []ast.Node, info *types.Info) *types.Basic {
+	basic, ok := info.TypeOf(lit).(*types.Basic)
+	if !ok {
+		return nil
+	}
+
+	for i := len(ancestors) - 1; basic.Info()&types.IsUntyped != 0 && i >= 0; i-- {
+		var expr ast.Expr
+		switch e := ancestors[i].(type) {
+		case *ast.UnaryExpr, *ast.BinaryExpr, *ast.ParenExpr:
+			expr = e.(ast.Expr)
+		default:
+			return basic
+		}
+
+		outer, ok := info.TypeOf(expr).(*types.Basic)
+		if !ok {
+			return basic
+		}
+		basic = outer
+	}
+
+	return basic
+}
+
+// obfuscateNumber dispatches an INT, FLOAT or IMAG basic literal to the
+// matching helper below, preserving its original typed kind via basic.
+func obfuscateNumber(lit *ast.BasicLit, basic *types.Basic, policy *Policy) (ast.Expr, []ast.Decl, bool) {
+	switch basic.Kind() {
+	case types.Float32, types.Float64, types.UntypedFloat:
+		return obfuscateFloat(lit, basic, policy)
+	case types.Complex64, types.Complex128, types.UntypedComplex:
+		return obfuscateComplex(lit, basic, policy)
+	default:
+		return obfuscateInt(lit, basic, policy)
+	}
+}
+
+// intByteWidth returns the number of bytes basic's values occupy, so
+// obfuscateInt only carries as many bytes through the obfuscator as the
+// literal's own width, instead of always widening to 8.
+func intByteWidth(basic *types.Basic) int {
+	switch basic.Kind() {
+	case types.Int8, types.Uint8:
+		return 1
+	case types.Int16, types.Uint16:
+		return 2
+	case types.Int32, types.Uint32, types.UntypedRune:
+		return 4
+	default:
+		return 8
+	}
+}
+
+// obfuscateInt wraps an integer literal in a lambda that XOR-masks its bytes
+// via the registered obfuscators and recombines them with the kind's
+// original width (1-8 bytes), so the result still type-checks as basic.
+func obfuscateInt(lit *ast.BasicLit, basic *types.Basic, policy *Policy) (ast.Expr, []ast.Decl, bool) {
+	raw := strings.ReplaceAll(lit.Value, "_", "")
+	value, err := strconv.ParseUint(raw, 0, 64)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	data := make([]byte, intByteWidth(basic))
+	for i := range data {
+		data[i] = byte(value >> (8 * i))
+	}
+
+	block, decls := obfuscateBlock(data, policy)
+
+	resultType := &ast.Ident{Name: basicResultName(basic)}
+	block.List = append(block.List, returnStmt(&ast.CallExpr{
+		Fun:  resultType,
+		Args: []ast.Expr{recomposeUint(len(data))},
+	}))
+
+	return callExpr(resultType, block), decls, true
+}
+
+// obfuscateFloat wraps a float literal in a lambda that reconstructs its IEEE
+// 754 bits through the registered obfuscators and math.Float32/64frombits.
+func obfuscateFloat(lit *ast.BasicLit, basic *types.Basic, policy *Policy) (ast.Expr, []ast.Decl, bool) {
+	raw := strings.ReplaceAll(lit.Value, "_", "")
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	is32 := basic.Kind() == types.Float32
+
+	var bits uint64
+	var size int
+	if is32 {
+		bits = uint64(math.Float32bits(float32(value)))
+		size = 4
+	} else {
+		bits = math.Float64bits(value)
+		size = 8
+	}
+
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(bits >> (8 * i))
+	}
+
+	block, decls := obfuscateBlock(data, policy)
+
+	fromBits, argType := "Float64frombits", "uint64"
+	if is32 {
+		fromBits, argType = "Float32frombits", "uint32"
+	}
+
+	resultType := &ast.Ident{Name: basicResultName(basic)}
+	block.List = append(block.List, returnStmt(&ast.CallExpr{
+		Fun: resultType,
+		Args: []ast.Expr{&ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   &ast.Ident{Name: "math"},
+				Sel: &ast.Ident{Name: fromBits},
+			},
+			Args: []ast.Expr{&ast.CallExpr{
+				Fun:  &ast.Ident{Name: argType},
+				Args: []ast.Expr{recomposeUint(size)},
+			}},
+		}},
+	}))
+
+	return callExpr(resultType, block), decls, true
+}
+
+// obfuscateComplex handles a literal with a complex type: a standalone
+// imaginary literal (e.g. 3i), which has a zero real part, or an int/float
+// literal implicitly converted to complex64/128, which has a zero imaginary
+// part. Either way it obfuscates both parts as floats and recombines them
+// with the builtin complex().
+func obfuscateComplex(lit *ast.BasicLit, basic *types.Basic, policy *Policy) (ast.Expr, []ast.Decl, bool) {
+	raw := strings.ReplaceAll(lit.Value, "_", "")
+
+	var realPart, imagPart float64
+	if lit.Kind == token.IMAG {
+		imag, err := strconv.ParseFloat(strings.TrimSuffix(raw, "i"), 64)
+		if err != nil {
+			return nil, nil, false
+		}
+		imagPart = imag
+	} else {
+		real, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, nil, false
+		}
+		realPart = real
+	}
+
+	floatKind := types.Float64
+	if basic.Kind() == types.Complex64 {
+		floatKind = types.Float32
+	}
+	floatBasic := types.Typ[floatKind]
+
+	realLit := &ast.BasicLit{Kind: token.FLOAT, Value: strconv.FormatFloat(realPart, 'g', -1, 64)}
+	realExpr, realDecls, ok := obfuscateFloat(realLit, floatBasic, policy)
+	if !ok {
+		return nil, nil, false
+	}
+	imagLit := &ast.BasicLit{Kind: token.FLOAT, Value: strconv.FormatFloat(imagPart, 'g', -1, 64)}
+	imagExpr, imagDecls, ok := obfuscateFloat(imagLit, floatBasic, policy)
+	if !ok {
+		return nil, nil, false
+	}
+
+	return &ast.CallExpr{
+		Fun:  &ast.Ident{Name: "complex"},
+		Args: []ast.Expr{realExpr, imagExpr},
+	}, append(realDecls, imagDecls...), true
 }
 
 // ConstBlacklist blacklist identifieres used in constant expressions
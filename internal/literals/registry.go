@@ -0,0 +1,383 @@
+package literals
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	mathrand "math/rand"
+	"sync"
+	"time"
+)
+
+// Obfuscator implements a single literal-encoding strategy. Given the raw
+// bytes of a literal it returns a block of statements that reconstructs them
+// into a []byte named "data", ready for the caller to append a final return.
+// rng is the build's seeded source (see Policy.Seed); an obfuscator must draw
+// all of its randomness - key bytes, generated names, anything that affects
+// the emitted code - from rng rather than the global math/rand, or pinning
+// Policy.Seed won't make the build reproducible.
+type Obfuscator interface {
+	Obfuscate(data []byte, rng *mathrand.Rand) *ast.BlockStmt
+}
+
+// DeclObfuscator is an Obfuscator that also needs package-level declarations
+// spliced into the file being rewritten, rather than keeping everything
+// inside the returned block - e.g. to stash literal fragments in several
+// unrelated-looking package vars instead of one inline byte slice. Obfuscate
+// is still required so a DeclObfuscator can be used wherever a plain
+// Obfuscator is expected; since that path has nowhere to splice declarations
+// in, it must build a self-contained block rather than one that references
+// declarations it never emits.
+type DeclObfuscator interface {
+	Obfuscator
+	Decls(data []byte, rng *mathrand.Rand) (*ast.BlockStmt, []ast.Decl)
+}
+
+var (
+	registryMu    sync.Mutex
+	registry      = map[string]Obfuscator{}
+	registryOrder []string
+)
+
+// Register adds a named Obfuscator that a Policy can select from. Packages
+// outside literals can call this from an init func to plug in a custom
+// encoder (an RC4 stream, AES-CTR with an embedded key schedule, a
+// stack-string builder, a control-flow-flattened decoder, ...) without
+// editing this package. Register panics on a duplicate name.
+func Register(name string, o Obfuscator) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("literals: obfuscator %q already registered", name))
+	}
+	registry[name] = o
+	registryOrder = append(registryOrder, name)
+}
+
+func init() {
+	Register("simple", simpleObfuscator{})
+	Register("scatter", scatterObfuscator{})
+}
+
+// SelectMode controls how a Policy picks an Obfuscator for a literal.
+type SelectMode int
+
+const (
+	// SelectRandom picks uniformly at random among the eligible obfuscators,
+	// using the Policy's seeded source. This is the default mode.
+	SelectRandom SelectMode = iota
+	// SelectRoundRobin cycles through the eligible obfuscators in
+	// registration order.
+	SelectRoundRobin
+	// SelectWeighted picks at random, biased by Policy.Weights.
+	SelectWeighted
+	// SelectNamed returns the obfuscator registered as Policy.Name, or the
+	// "simple" obfuscator if no obfuscator is registered under that name.
+	SelectNamed
+)
+
+// Policy controls obfuscator selection for a single build: which encoders
+// are eligible, how one is chosen per literal, and the size range of
+// literals worth obfuscating at all. The zero value is SelectRandom with no
+// size filtering and a time-seeded source.
+type Policy struct {
+	Mode SelectMode
+	// Name pins the obfuscator used when Mode is SelectNamed.
+	Name string
+	// Weights gives the relative selection weight of each obfuscator name,
+	// used when Mode is SelectWeighted. Names absent from Weights are never
+	// selected, unless no eligible name has a positive weight, in which case
+	// every eligible name is equally likely.
+	Weights map[string]int
+	// Seed makes obfuscator selection reproducible across a build. The zero
+	// value seeds from the current time instead.
+	Seed int64
+	// MinSize and MaxSize bound which literals are handed to the registry at
+	// all; literals outside the range fall back to the "simple" obfuscator.
+	// A zero MaxSize means no upper bound.
+	MinSize int
+	MaxSize int
+
+	initOnce sync.Once
+	source   *mathrand.Rand
+	next     int
+}
+
+func (p *Policy) init() {
+	p.initOnce.Do(func() {
+		seed := p.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		p.source = mathrand.New(mathrand.NewSource(seed))
+	})
+}
+
+// eligible reports the registered obfuscator names data may be handed to,
+// in registration order, after applying the Policy's size filter.
+func (p *Policy) eligible(data []byte) []string {
+	if p.MinSize > 0 && len(data) < p.MinSize {
+		return nil
+	}
+	if p.MaxSize > 0 && len(data) > p.MaxSize {
+		return nil
+	}
+	return registryOrder
+}
+
+// pick selects the Obfuscator to use for data according to the Policy. When
+// nothing is eligible - an empty registry, a named obfuscator that was never
+// registered, or data outside the size bounds - it falls back to the
+// "simple" obfuscator so callers never have to special-case a nil result.
+func (p *Policy) pick(data []byte) Obfuscator {
+	p.init()
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := p.eligible(data)
+	if len(names) == 0 {
+		return simpleObfuscator{}
+	}
+
+	if p.Mode == SelectNamed {
+		if o, ok := registry[p.Name]; ok {
+			return o
+		}
+		return simpleObfuscator{}
+	}
+
+	switch p.Mode {
+	case SelectRoundRobin:
+		name := names[p.next%len(names)]
+		p.next++
+		return registry[name]
+
+	case SelectWeighted:
+		total := 0
+		for _, name := range names {
+			total += p.Weights[name]
+		}
+		if total <= 0 {
+			return registry[names[p.source.Intn(len(names))]]
+		}
+		r := p.source.Intn(total)
+		for _, name := range names {
+			r -= p.Weights[name]
+			if r < 0 {
+				return registry[name]
+			}
+		}
+		return registry[names[len(names)-1]]
+
+	default: // SelectRandom
+		return registry[names[p.source.Intn(len(names))]]
+	}
+}
+
+// xorUnmaskStmt builds the `for i := range data { data[i] ^= key[i] }` loop
+// shared by every obfuscator that reconstructs data by XOR-combining it with
+// an equal-length key, so each encoder only has to build data and key.
+func xorUnmaskStmt() ast.Stmt {
+	return &ast.RangeStmt{
+		Key: &ast.Ident{Name: "i"},
+		Tok: token.DEFINE,
+		X:   &ast.Ident{Name: "data"},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.IndexExpr{
+					X:     &ast.Ident{Name: "data"},
+					Index: &ast.Ident{Name: "i"},
+				}},
+				Tok: token.XOR_ASSIGN,
+				Rhs: []ast.Expr{&ast.IndexExpr{
+					X:     &ast.Ident{Name: "key"},
+					Index: &ast.Ident{Name: "i"},
+				}},
+			},
+		}},
+	}
+}
+
+// byteSliceLit builds the composite literal []byte{0x.., 0x.., ...} for data.
+func byteSliceLit(data []byte) *ast.CompositeLit {
+	elts := make([]ast.Expr, len(data))
+	for i, b := range data {
+		elts[i] = &ast.BasicLit{Kind: token.INT, Value: fmt.Sprintf("0x%02x", b)}
+	}
+	return &ast.CompositeLit{
+		Type: &ast.ArrayType{Elt: &ast.Ident{Name: "byte"}},
+		Elts: elts,
+	}
+}
+
+// simpleObfuscator is the package's baseline encoder: it masks the literal
+// with a randomly generated key of equal length and reconstructs it with a
+// single XOR loop.
+type simpleObfuscator struct{}
+
+func (simpleObfuscator) Obfuscate(data []byte, rng *mathrand.Rand) *ast.BlockStmt {
+	key := make([]byte, len(data))
+	rng.Read(key)
+
+	masked := make([]byte, len(data))
+	for i, b := range data {
+		masked[i] = b ^ key[i]
+	}
+
+	return &ast.BlockStmt{List: []ast.Stmt{
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: "data"}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{byteSliceLit(masked)},
+		},
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: "key"}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{byteSliceLit(key)},
+		},
+		xorUnmaskStmt(),
+	}}
+}
+
+// scatterWords and scatterCounter back nextScatterName: a small pool of
+// innocuous-looking words combined with a monotonic counter, so names look
+// like ordinary package vars (bufHeader3, seedTable1, ...) while still being
+// unique across every file an Obfuscate call rewrites.
+var (
+	scatterNamesMu sync.Mutex
+	scatterCounter int
+)
+
+var scatterWords = []string{
+	"bufHeader", "seedTable", "frameSlot", "cacheLine",
+	"tokenMask", "stateFlag", "cfgDefault", "retryLimit",
+}
+
+func nextScatterName(rng *mathrand.Rand) string {
+	scatterNamesMu.Lock()
+	defer scatterNamesMu.Unlock()
+
+	scatterCounter++
+	word := scatterWords[rng.Intn(len(scatterWords))]
+	return fmt.Sprintf("%s%d", word, scatterCounter)
+}
+
+// scatterChunks splits data into up to n contiguous, roughly equal pieces,
+// in order, so concatenating them back together reproduces data.
+func scatterChunks(data []byte, n int) [][]byte {
+	if n < 1 {
+		n = 1
+	}
+	if len(data) == 0 {
+		return [][]byte{data}
+	}
+
+	size := (len(data) + n - 1) / n
+
+	var chunks [][]byte
+	for i := 0; i < len(data); i += size {
+		end := i + size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, data[i:end])
+	}
+	return chunks
+}
+
+// scatterChunkCount is the most vars scatterObfuscator splits a literal
+// across; a short literal may yield fewer (see scatterChunks).
+const scatterChunkCount = 3
+
+// scatterObfuscator splits the literal into several package-level vars with
+// unrelated names, then gathers and XOR-combines them back together at call
+// time. A tool grepping the binary for a contiguous high-entropy blob, or
+// scanning for one large string table, sees only scattered low-entropy
+// fragments under innocuous names instead.
+type scatterObfuscator struct{}
+
+// scatterMask XOR-masks data with a freshly drawn key of equal length,
+// shared by both scatterObfuscator paths below.
+func scatterMask(data []byte, rng *mathrand.Rand) (masked, key []byte) {
+	key = make([]byte, len(data))
+	rng.Read(key)
+
+	masked = make([]byte, len(data))
+	for i, b := range data {
+		masked[i] = b ^ key[i]
+	}
+	return masked, key
+}
+
+// appendChunk extends gather with `append(gather, name...)`, the expression
+// both scatterObfuscator paths use to reassemble their chunks in order.
+func appendChunk(gather ast.Expr, name string) ast.Expr {
+	return &ast.CallExpr{
+		Fun:      &ast.Ident{Name: "append"},
+		Args:     []ast.Expr{gather, &ast.Ident{Name: name}},
+		Ellipsis: token.Pos(1), // append(gather, name...)
+	}
+}
+
+// scatterFinish appends the data/key assembly and XOR-unmask loop shared by
+// both scatterObfuscator paths to stmts, which already declare each chunk.
+func scatterFinish(stmts []ast.Stmt, gather ast.Expr, key []byte) *ast.BlockStmt {
+	stmts = append(stmts,
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: "data"}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{gather},
+		},
+		&ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: "key"}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{byteSliceLit(key)},
+		},
+		xorUnmaskStmt(),
+	)
+	return &ast.BlockStmt{List: stmts}
+}
+
+// Obfuscate is the DeclObfuscator's plain-Obfuscator fallback (see
+// DeclObfuscator). That path has nowhere to splice in declarations, so unlike
+// Decls this scatters the literal across local vars inside the block itself
+// instead of package vars, keeping the block self-contained.
+func (scatterObfuscator) Obfuscate(data []byte, rng *mathrand.Rand) *ast.BlockStmt {
+	masked, key := scatterMask(data, rng)
+
+	var stmts []ast.Stmt
+	var gather ast.Expr = &ast.CompositeLit{Type: &ast.ArrayType{Elt: &ast.Ident{Name: "byte"}}}
+	for i, chunk := range scatterChunks(masked, scatterChunkCount) {
+		name := fmt.Sprintf("chunk%d", i)
+		stmts = append(stmts, &ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: name}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{byteSliceLit(chunk)},
+		})
+		gather = appendChunk(gather, name)
+	}
+
+	return scatterFinish(stmts, gather, key)
+}
+
+func (scatterObfuscator) Decls(data []byte, rng *mathrand.Rand) (*ast.BlockStmt, []ast.Decl) {
+	masked, key := scatterMask(data, rng)
+
+	var decls []ast.Decl
+	var gather ast.Expr = &ast.CompositeLit{Type: &ast.ArrayType{Elt: &ast.Ident{Name: "byte"}}}
+	for _, chunk := range scatterChunks(masked, scatterChunkCount) {
+		name := nextScatterName(rng)
+		decls = append(decls, &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names:  []*ast.Ident{{Name: name}},
+				Values: []ast.Expr{byteSliceLit(chunk)},
+			}},
+		})
+		gather = appendChunk(gather, name)
+	}
+
+	return scatterFinish(nil, gather, key), decls
+}